@@ -1,4 +1,4 @@
-// Command partial-aftersun deletes partial tiles from a Sunlight local backend
+// Command partial-aftersun deletes partial tiles from a Sunlight backend
 // where a corresponding full tile exists.
 package main
 
@@ -8,16 +8,14 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/fs"
+	"iter"
 	"log/slog"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strconv"
 	"strings"
 
 	"filippo.io/sunlight"
-	"filippo.io/sunlight/internal/immutable"
+	"filippo.io/sunlight/internal/ctlog"
 	"filippo.io/sunlight/internal/stdlog"
 	"filippo.io/torchwood"
 	"golang.org/x/mod/sumdb/note"
@@ -29,8 +27,104 @@ type LogConfig struct {
 	ShortName string
 
 	// LocalDirectory is the path to a local directory where the log will store
-	// its data. It must be dedicated to this specific log instance.
+	// its data. It must be dedicated to this specific log instance. Exactly
+	// one of LocalDirectory, S3, GCS, or Azure must be set.
 	LocalDirectory string
+
+	// S3, if set, points partial-aftersun at the log's S3 backend instead of
+	// a local directory.
+	S3 *S3Config
+
+	// GCS, if set, points partial-aftersun at the log's GCS backend instead
+	// of a local directory.
+	GCS *GCSConfig
+
+	// Azure, if set, points partial-aftersun at the log's Azure Blob Storage
+	// backend instead of a local directory.
+	Azure *AzureConfig
+}
+
+type S3Config struct {
+	Region    string
+	Bucket    string
+	Endpoint  string
+	KeyPrefix string
+}
+
+type GCSConfig struct {
+	Bucket    string
+	KeyPrefix string
+}
+
+type AzureConfig struct {
+	ServiceURL    string
+	ContainerName string
+	KeyPrefix     string
+}
+
+// backend is the subset of ctlog.Backend that partial-aftersun needs:
+// listing keys under a prefix, fetching a tile to check it's non-empty, and
+// discarding partial tiles once they've been confirmed safe to remove.
+type backend interface {
+	ctlog.Backend
+	List(ctx context.Context, prefix string) iter.Seq2[string, error]
+	Discard(ctx context.Context, key string) error
+}
+
+// deleteKeyAllowlist scopes Discard to partial tiles: they are never
+// right-edge or full tiles, so it's safe to allow this tightly. "**"
+// matches the tile's intermediate x-groups, whose count varies with level
+// and index; the last two segments are the ".p"-suffixed node and its
+// width.
+var deleteKeyAllowlist = []string{"tile/**/*.p/*"}
+
+func backendFor(ctx context.Context, lc LogConfig, logger *slog.Logger) (backend, error) {
+	var driver string
+	var cfg any
+	switch {
+	case lc.S3 != nil:
+		driver = "s3"
+		cfg = ctlog.S3BackendConfig{
+			Region:             lc.S3.Region,
+			Bucket:             lc.S3.Bucket,
+			Endpoint:           lc.S3.Endpoint,
+			KeyPrefix:          lc.S3.KeyPrefix,
+			UnsafeDelete:       true,
+			DeleteKeyAllowlist: deleteKeyAllowlist,
+		}
+	case lc.GCS != nil:
+		driver = "gcs"
+		cfg = ctlog.GCSBackendConfig{
+			Bucket:             lc.GCS.Bucket,
+			KeyPrefix:          lc.GCS.KeyPrefix,
+			UnsafeDelete:       true,
+			DeleteKeyAllowlist: deleteKeyAllowlist,
+		}
+	case lc.Azure != nil:
+		driver = "azblob"
+		cfg = ctlog.AzureBlobBackendConfig{
+			ServiceURL:         lc.Azure.ServiceURL,
+			ContainerName:      lc.Azure.ContainerName,
+			KeyPrefix:          lc.Azure.KeyPrefix,
+			UnsafeDelete:       true,
+			DeleteKeyAllowlist: deleteKeyAllowlist,
+		}
+	case lc.LocalDirectory != "":
+		driver = "local"
+		cfg = ctlog.LocalBackendConfig{Directory: lc.LocalDirectory}
+	default:
+		return nil, fmt.Errorf("log %q has no backend configured", lc.ShortName)
+	}
+
+	b, err := ctlog.NewBackend(ctx, driver, cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct %s backend: %w", driver, err)
+	}
+	bb, ok := b.(backend)
+	if !ok {
+		return nil, fmt.Errorf("%s backend does not support listing and discarding tiles", driver)
+	}
+	return bb, nil
 }
 
 func main() {
@@ -63,167 +157,112 @@ func main() {
 			slog.String("log", lc.ShortName),
 		}))
 
-		if lc.LocalDirectory == "" {
-			fatalError(logger, "missing LocalDirectory for log")
-		}
-		root, err := os.OpenRoot(lc.LocalDirectory)
+		b, err := backendFor(ctx, lc, logger)
 		if err != nil {
-			fatalError(logger, "failed to open local directory", "err", err)
+			fatalError(logger, "failed to open backend", "err", err)
 		}
 
-		size, err := logSize(root)
+		size, err := logSize(ctx, b)
 		if err != nil {
 			fatalError(logger, "failed to get log size", "err", err)
 		}
 
-		levels, err := fs.ReadDir(root.FS(), "tile")
-		if os.IsNotExist(err) {
-			logger.DebugContext(ctx, "tile directory does not exist, skipping")
-			continue
-		}
-		if err != nil {
-			fatalError(logger, "failed to read tile directory", "err", err)
-		}
-		for _, level := range levels {
-			name := filepath.Join("tile", level.Name())
-			if err := cleanDir(ctx, logger, root, name, size); err != nil {
-				logger.Error("failed to clean directory", "name", name, "err", err)
-				exitCode = 1
-				break
-			}
+		if err := cleanTiles(ctx, logger, b, size); err != nil {
+			logger.Error("failed to clean tiles", "err", err)
+			exitCode = 1
 		}
 	}
 
-	logger.Info("done", "files", removedFiles, "dirs", removedDirs, "bytes", removedBytes)
+	logger.Info("done", "files", removedFiles)
 	os.Exit(exitCode)
 }
 
 var removedFiles int64
-var removedDirs int64
-var removedBytes int64
-
-func cleanDir(ctx context.Context, logger *slog.Logger, root *os.Root, prefix string, size int64) error {
-	if err := ctx.Err(); err != nil {
-		return err
-	}
-	entries, err := fs.ReadDir(root.FS(), prefix)
-	if err != nil {
-		return err
-	}
-	names := make(map[string]fs.DirEntry, len(entries))
-	for _, entry := range entries {
-		names[entry.Name()] = entry
-	}
-	for _, entry := range entries {
-		name := filepath.Join(prefix, entry.Name())
 
-		if strings.HasPrefix(entry.Name(), "x") {
-			if err := cleanDir(ctx, logger, root, name, size); err != nil {
-				return err
-			}
+// cleanTiles removes partial tiles that have a corresponding full tile, are
+// not on the right edge of the tree, and are confirmed to really be
+// partial. It lists every tile key up front since, unlike a local
+// directory, a Backend has no notion of nested directories to recurse into.
+func cleanTiles(ctx context.Context, logger *slog.Logger, b backend, size int64) error {
+	full := make(map[string]bool)
+	partials := make(map[string][]string)
+	for key, err := range b.List(ctx, "tile") {
+		if err != nil {
+			return fmt.Errorf("failed to list tiles: %w", err)
+		}
+		if idx := strings.Index(key, ".p/"); idx >= 0 {
+			fullKey := key[:idx]
+			partials[fullKey] = append(partials[fullKey], key)
 			continue
 		}
-
-		// First level of safety: never delete a partial tile that doesn't have
-		// a corresponding full tile.
-		full, ok := strings.CutSuffix(entry.Name(), ".p")
-		if !ok {
+		if strings.HasSuffix(key, ".p") {
 			continue
 		}
-		if _, ok := names[full]; !ok {
+		full[key] = true
+	}
+
+	for fullKey, partialKeys := range partials {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// First level of safety: never delete a partial tile that doesn't
+		// have a corresponding full tile.
+		if !full[fullKey] {
 			continue
 		}
 
-		// Second level of safety: never delete a partial tile at the right edge
-		// of the tree.
-		t, err := sunlight.ParseTilePath(strings.TrimSuffix(name, ".p"))
+		// Second level of safety: never delete a partial tile at the right
+		// edge of the tree.
+		t, err := sunlight.ParseTilePath(fullKey)
 		if err != nil {
-			return fmt.Errorf("failed to parse tile path %s: %w", name, err)
+			return fmt.Errorf("failed to parse tile path %s: %w", fullKey, err)
 		}
 		tileSize := int64(1) << (sunlight.TileHeight * (max(0, t.L) + 1))
 		if t.N >= size/tileSize {
 			continue
 		}
 
-		partials, err := fs.ReadDir(root.FS(), name)
+		// Third level of safety: never delete a partial tile whose full
+		// tile is missing or empty. A Backend has no lightweight stat, so
+		// this costs a full fetch of the tile.
+		fullData, err := b.Fetch(ctx, fullKey)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to fetch full tile %s: %w", fullKey, err)
+		}
+		if len(fullData) == 0 {
+			return fmt.Errorf("full tile %s is empty", fullKey)
 		}
-		for _, partial := range partials {
-			name := filepath.Join(prefix, entry.Name(), partial.Name())
 
-			// Third level of safety: never delete a non-partial tile.
-			t, err := sunlight.ParseTilePath(name)
+		for _, partialKey := range partialKeys {
+			// Fourth level of safety: never delete a non-partial tile.
+			pt, err := sunlight.ParseTilePath(partialKey)
 			if err != nil {
-				return fmt.Errorf("failed to parse tile path %s: %w", name, err)
+				return fmt.Errorf("failed to parse tile path %s: %w", partialKey, err)
 			}
-			if t.W == sunlight.TileWidth {
-				return fmt.Errorf("%s is not a partial tile", name)
+			if pt.W == sunlight.TileWidth {
+				return fmt.Errorf("%s is not a partial tile", partialKey)
 			}
 
-			if err := overrideImmutable(root, name); err != nil {
-				return fmt.Errorf("failed to override immutable flag for %s: %w", name, err)
+			logger.DebugContext(ctx, "removing partial", "key", partialKey)
+			if err := b.Discard(ctx, partialKey); err != nil {
+				return fmt.Errorf("failed to discard %s: %w", partialKey, err)
 			}
-			logger.DebugContext(ctx, "removing partial", "name", name)
 			removedFiles++
-			i, err := partial.Info()
-			if err != nil {
-				return err
-			}
-			removedBytes += i.Size()
-			if err := root.Remove(name); err != nil {
-				return err
-			}
-		}
-		logger.DebugContext(ctx, "removing dir", "name", name)
-		removedDirs++
-		i, err := entry.Info()
-		if err != nil {
-			return err
-		}
-		removedBytes += i.Size()
-		if err := root.Remove(name); err != nil {
-			return err
 		}
 	}
 	return nil
 }
 
-func overrideImmutable(root *os.Root, name string) error {
-	// Fourth level of safety: refuse to make a partial tile if there isn't a
-	// full tile, which is checked through a *different* mechanism.
-	full, size, ok := strings.Cut(name, ".p/")
-	if !ok {
-		return fmt.Errorf("failed to parse partial tile path %s", name)
-	}
-	if _, err := strconv.Atoi(size); err != nil {
-		return fmt.Errorf("failed to parse partial tile size %s: %w", size, err)
-	}
-	if fi, err := root.Stat(full); err != nil {
-		return fmt.Errorf("failed to stat full tile %s: %w", full, err)
-	} else if fi.IsDir() {
-		return fmt.Errorf("full tile %s is a directory", full)
-	} else if fi.Size() == 0 {
-		return fmt.Errorf("full tile %s is empty", full)
-	}
-
-	f, err := root.Open(name)
-	if err != nil {
-		return err
-	}
-	immutable.Unset(f)
-	return f.Close()
-}
-
 type logInfo struct {
 	Name         string `json:"description"`
 	PublicKeyDER []byte `json:"key"`
 }
 
-func logSize(root *os.Root) (int64, error) {
-	logJSON, err := fs.ReadFile(root.FS(), "log.v3.json")
+func logSize(ctx context.Context, b backend) (int64, error) {
+	logJSON, err := b.Fetch(ctx, "log.v3.json")
 	if err != nil {
-		return 0, fmt.Errorf("failed to read log.v3.json: %w", err)
+		return 0, fmt.Errorf("failed to fetch log.v3.json: %w", err)
 	}
 	var log logInfo
 	if err := json.Unmarshal(logJSON, &log); err != nil {
@@ -237,9 +276,9 @@ func logSize(root *os.Root) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to create verifier: %w", err)
 	}
-	signedCheckpoint, err := fs.ReadFile(root.FS(), "checkpoint")
+	signedCheckpoint, err := b.Fetch(ctx, "checkpoint")
 	if err != nil {
-		return 0, fmt.Errorf("failed to read checkpoint: %w", err)
+		return 0, fmt.Errorf("failed to fetch checkpoint: %w", err)
 	}
 	n, err := note.Open(signedCheckpoint, note.VerifierList(verifier))
 	if err != nil {
@@ -0,0 +1,249 @@
+package ctlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AzureBlobBackendConfig holds the parameters for NewAzureBlobBackend.
+type AzureBlobBackendConfig struct {
+	ServiceURL    string
+	ContainerName string
+	KeyPrefix     string
+
+	// UnsafeDelete must be set for Discard to issue a delete at all; by
+	// default Discard always refuses, mirroring S3BackendConfig.
+	UnsafeDelete bool
+
+	// DeleteKeyAllowlist, if non-empty, restricts Discard to keys matching
+	// one of these globMatch patterns, even when UnsafeDelete is set.
+	DeleteKeyAllowlist []string
+}
+
+type AzureBlobBackend struct {
+	client          *azblob.Client
+	containerName   string
+	keyPrefix       string
+	unsafeDelete    bool
+	deleteAllowlist []string
+	metrics         []prometheus.Collector
+	uploadSize      prometheus.Summary
+	deletes         *prometheus.CounterVec
+	log             *slog.Logger
+}
+
+func init() {
+	RegisterBackend("azblob", func(ctx context.Context, cfg any, l *slog.Logger) (Backend, error) {
+		c, ok := cfg.(AzureBlobBackendConfig)
+		if !ok {
+			return nil, fmt.Errorf("azblob backend config must be a AzureBlobBackendConfig, got %T", cfg)
+		}
+		return NewAzureBlobBackend(ctx, c, l)
+	})
+}
+
+func NewAzureBlobBackend(ctx context.Context, cfg AzureBlobBackendConfig, l *slog.Logger) (*AzureBlobBackend, error) {
+	duration := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "azblob_request_duration_seconds",
+			Help:       "Azure Blob Storage HTTP request latencies, by method and response code.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+		[]string{"method", "code"},
+	)
+	errorCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azblob_errors_total",
+			Help: "Azure Blob Storage attempt error codes, by whether the error is retryable (429, 5xx, or transport error).",
+		},
+		[]string{"retryable", "errorcode"},
+	)
+	uploadSize := prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Name:       "azblob_upload_size_bytes",
+			Help:       "Azure Blob Storage body size in bytes for blob uploads.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+	)
+	deletes := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "azblob_deletes_total",
+			Help: "Azure Blob Storage Discard calls, by whether the delete was allowed to proceed.",
+		},
+		[]string{"allowed"},
+	)
+
+	transport := http.RoundTripper(http.DefaultTransport.(*http.Transport).Clone())
+	transport = promhttp.InstrumentRoundTripperDuration(duration, transport)
+	transport = &azureErrorTrackingRoundTripper{RoundTripper: transport, errors: errorCounter}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Azure credential for Blob Storage backend: %w", err)
+	}
+	client, err := azblob.NewClient(cfg.ServiceURL, cred, &azblob.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Transport: &http.Client{Transport: transport},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob Storage client: %w", err)
+	}
+
+	return &AzureBlobBackend{
+		client:          client,
+		containerName:   cfg.ContainerName,
+		keyPrefix:       cfg.KeyPrefix,
+		unsafeDelete:    cfg.UnsafeDelete,
+		deleteAllowlist: cfg.DeleteKeyAllowlist,
+		metrics:         []prometheus.Collector{duration, errorCounter, uploadSize, deletes},
+		uploadSize:      uploadSize,
+		deletes:         deletes,
+		log:             l,
+	}, nil
+}
+
+// azureErrorTrackingRoundTripper counts Azure Blob Storage API errors by
+// code, mirroring S3Backend's trackingRetryerV2.
+type azureErrorTrackingRoundTripper struct {
+	http.RoundTripper
+	errors *prometheus.CounterVec
+}
+
+func (t *azureErrorTrackingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		t.errors.WithLabelValues("true", "transport").Inc()
+		return resp, err
+	}
+	if resp.StatusCode >= 400 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		t.errors.WithLabelValues(fmt.Sprint(retryable), fmt.Sprint(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
+
+var _ Backend = &AzureBlobBackend{}
+
+func (a *AzureBlobBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	start := time.Now()
+
+	contentType := "application/octet-stream"
+	if opts != nil && opts.ContentType != "" {
+		contentType = opts.ContentType
+	}
+	var contentEncoding, cacheControl *string
+	if opts != nil && opts.Compressed {
+		contentEncoding = to.Ptr("gzip")
+	}
+	uploadOpts := &azblob.UploadBufferOptions{}
+	if opts != nil && opts.Immutable {
+		cacheControl = to.Ptr("public, max-age=604800, immutable")
+		uploadOpts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfNoneMatch: to.Ptr(azcore.ETagAny),
+			},
+		}
+	}
+	uploadOpts.HTTPHeaders = &blob.HTTPHeaders{
+		BlobContentType:     to.Ptr(contentType),
+		BlobContentEncoding: contentEncoding,
+		BlobCacheControl:    cacheControl,
+	}
+
+	_, err := a.client.UploadBuffer(ctx, a.containerName, a.keyPrefix+key, data, uploadOpts)
+	if opts != nil && opts.Immutable && bloberror.HasCode(err, bloberror.BlobAlreadyExists) {
+		// The blob already exists; treat that as success, not an error.
+		// Unlike LocalBackend, the existing blob's contents are not
+		// compared with data.
+		err = nil
+	}
+	a.log.DebugContext(ctx, "Azure Blob Storage upload", "key", key, "size", len(data),
+		"compressed", contentEncoding != nil, "type", contentType,
+		"immutable", cacheControl != nil, "elapsed", time.Since(start), "err", err)
+	a.uploadSize.Observe(float64(len(data)))
+	if err != nil {
+		return fmtErrorf("failed to upload %q to Azure Blob Storage: %w", key, err)
+	}
+	return nil
+}
+
+func (a *AzureBlobBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	out, err := a.client.DownloadStream(ctx, a.containerName, a.keyPrefix+key, nil)
+	if err != nil {
+		a.log.DebugContext(ctx, "Azure Blob Storage download", "key", key, "err", err)
+		return nil, fmtErrorf("failed to fetch %q from Azure Blob Storage: %w", key, err)
+	}
+	defer out.Body.Close()
+	a.log.DebugContext(ctx, "Azure Blob Storage download", "key", key,
+		"size", out.ContentLength, "encoding", out.ContentEncoding)
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmtErrorf("failed to read %q from Azure Blob Storage: %w", key, err)
+	}
+	return data, nil
+}
+
+// Discard deletes key from Azure Blob Storage. It refuses to do so unless
+// UnsafeDelete was set on the AzureBlobBackendConfig and, if
+// DeleteKeyAllowlist is non-empty, key matches one of its patterns.
+func (a *AzureBlobBackend) Discard(ctx context.Context, key string) error {
+	allowed := deleteAllowed(a.unsafeDelete, a.deleteAllowlist, key)
+	a.deletes.WithLabelValues(fmt.Sprint(allowed)).Inc()
+	if !allowed {
+		return fmtErrorf("refusing to delete %q from Azure Blob Storage: UnsafeDelete is not set for this key", key)
+	}
+	_, err := a.client.DeleteBlob(ctx, a.containerName, a.keyPrefix+key, nil)
+	a.log.DebugContext(ctx, "Azure Blob Storage delete", "key", key, "err", err)
+	if err != nil {
+		return fmtErrorf("failed to delete %q from Azure Blob Storage: %w", key, err)
+	}
+	return nil
+}
+
+// List yields every key with the given prefix, stopping early if the
+// consumer returns false.
+func (a *AzureBlobBackend) List(ctx context.Context, prefix string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		fullPrefix := a.keyPrefix + prefix
+		pager := a.client.NewListBlobsFlatPager(a.containerName, &azblob.ListBlobsFlatOptions{
+			Prefix: &fullPrefix,
+		})
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				yield("", fmtErrorf("failed to list %q from Azure Blob Storage: %w", prefix, err))
+				return
+			}
+			for _, item := range page.Segment.BlobItems {
+				key := strings.TrimPrefix(*item.Name, a.keyPrefix)
+				if !yield(key, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AzureBlobBackend) Metrics() []prometheus.Collector {
+	return a.metrics
+}
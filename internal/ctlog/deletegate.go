@@ -0,0 +1,58 @@
+package ctlog
+
+import (
+	"path"
+	"strings"
+)
+
+// deleteAllowed reports whether a Discard call may proceed: unsafeDelete
+// must be set, and if allowlist is non-empty, key must match one of its
+// globMatch patterns. It is shared by every Backend that gates deletes
+// behind an UnsafeDelete flag and an optional DeleteKeyAllowlist.
+func deleteAllowed(unsafeDelete bool, allowlist []string, key string) bool {
+	if !unsafeDelete {
+		return false
+	}
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, pattern := range allowlist {
+		if globMatch(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether key matches pattern. Both are split on "/" and
+// matched segment by segment with path.Match, except that a "**" segment in
+// pattern matches any number (including zero) of key segments. The "**"
+// case is needed for CT tile keys, whose depth varies with both tile level
+// and whether the key names a partial tile (which appends a ".p/<width>"
+// suffix), so a single path.Match-style pattern without it cannot express
+// "any tile path ending in a partial tile".
+func globMatch(pattern, key string) bool {
+	return globMatchSegments(strings.Split(pattern, "/"), strings.Split(key, "/"))
+}
+
+func globMatchSegments(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	if pattern[0] == "**" {
+		if globMatchSegments(pattern[1:], key) {
+			return true
+		}
+		if len(key) == 0 {
+			return false
+		}
+		return globMatchSegments(pattern, key[1:])
+	}
+	if len(key) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], key[0]); !ok {
+		return false
+	}
+	return globMatchSegments(pattern[1:], key[1:])
+}
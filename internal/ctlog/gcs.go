@@ -0,0 +1,240 @@
+package ctlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSBackendConfig holds the parameters for NewGCSBackend.
+type GCSBackendConfig struct {
+	Bucket    string
+	KeyPrefix string
+
+	// UnsafeDelete must be set for Discard to issue a delete at all; by
+	// default Discard always refuses, mirroring S3BackendConfig.
+	UnsafeDelete bool
+
+	// DeleteKeyAllowlist, if non-empty, restricts Discard to keys matching
+	// one of these globMatch patterns, even when UnsafeDelete is set.
+	DeleteKeyAllowlist []string
+}
+
+type GCSBackend struct {
+	client          *storage.Client
+	bucket          string
+	keyPrefix       string
+	unsafeDelete    bool
+	deleteAllowlist []string
+	metrics         []prometheus.Collector
+	uploadSize      prometheus.Summary
+	deletes         *prometheus.CounterVec
+	log             *slog.Logger
+}
+
+func init() {
+	RegisterBackend("gcs", func(ctx context.Context, cfg any, l *slog.Logger) (Backend, error) {
+		c, ok := cfg.(GCSBackendConfig)
+		if !ok {
+			return nil, fmt.Errorf("gcs backend config must be a GCSBackendConfig, got %T", cfg)
+		}
+		return NewGCSBackend(ctx, c, l)
+	})
+}
+
+func NewGCSBackend(ctx context.Context, cfg GCSBackendConfig, l *slog.Logger) (*GCSBackend, error) {
+	duration := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "gcs_request_duration_seconds",
+			Help:       "GCS HTTP request latencies, by method and response code.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.025, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+		[]string{"method", "code"},
+	)
+	errorCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_errors_total",
+			Help: "GCS attempt error codes, by whether the error is retryable (429, 5xx, or transport error).",
+		},
+		[]string{"retryable", "errorcode"},
+	)
+	uploadSize := prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Name:       "gcs_upload_size_bytes",
+			Help:       "GCS body size in bytes for object writes.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+	)
+	deletes := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_deletes_total",
+			Help: "GCS Discard calls, by whether the delete was allowed to proceed.",
+		},
+		[]string{"allowed"},
+	)
+
+	transport := http.RoundTripper(http.DefaultTransport.(*http.Transport).Clone())
+	transport = promhttp.InstrumentRoundTripperDuration(duration, transport)
+	transport = &gcsErrorTrackingRoundTripper{RoundTripper: transport, errors: errorCounter}
+
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	return &GCSBackend{
+		client:          client,
+		bucket:          cfg.Bucket,
+		keyPrefix:       cfg.KeyPrefix,
+		unsafeDelete:    cfg.UnsafeDelete,
+		deleteAllowlist: cfg.DeleteKeyAllowlist,
+		metrics:         []prometheus.Collector{duration, errorCounter, uploadSize, deletes},
+		uploadSize:      uploadSize,
+		deletes:         deletes,
+		log:             l,
+	}, nil
+}
+
+// gcsErrorTrackingRoundTripper counts GCS API errors by code, mirroring
+// S3Backend's trackingRetryerV2.
+type gcsErrorTrackingRoundTripper struct {
+	http.RoundTripper
+	errors *prometheus.CounterVec
+}
+
+func (t *gcsErrorTrackingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		t.errors.WithLabelValues("true", "transport").Inc()
+		return resp, err
+	}
+	if resp.StatusCode >= 400 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		t.errors.WithLabelValues(fmt.Sprint(retryable), fmt.Sprint(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
+
+var _ Backend = &GCSBackend{}
+
+func (g *GCSBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	start := time.Now()
+	obj := g.client.Bucket(g.bucket).Object(g.keyPrefix + key)
+
+	contentType := "application/octet-stream"
+	if opts != nil && opts.ContentType != "" {
+		contentType = opts.ContentType
+	}
+	var contentEncoding, cacheControl string
+	if opts != nil && opts.Compressed {
+		contentEncoding = "gzip"
+	}
+	if opts != nil && opts.Immutable {
+		cacheControl = "public, max-age=604800, immutable"
+		obj = obj.If(storage.Conditions{DoesNotExist: true})
+	}
+
+	w := obj.NewWriter(ctx)
+	w.ContentType = contentType
+	w.ContentEncoding = contentEncoding
+	w.CacheControl = cacheControl
+	_, err := w.Write(data)
+	if err == nil {
+		err = w.Close()
+	}
+	if opts != nil && opts.Immutable && isPreconditionFailed(err) {
+		// The object already exists; treat that as success, not an error.
+		// Unlike LocalBackend, the existing object's contents are not
+		// compared with data.
+		err = nil
+	}
+	g.log.DebugContext(ctx, "GCS write", "key", key, "size", len(data),
+		"compressed", contentEncoding != "", "type", contentType,
+		"immutable", cacheControl != "", "elapsed", time.Since(start), "err", err)
+	g.uploadSize.Observe(float64(len(data)))
+	if err != nil {
+		return fmtErrorf("failed to upload %q to GCS: %w", key, err)
+	}
+	return nil
+}
+
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+func (g *GCSBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	r, err := g.client.Bucket(g.bucket).Object(g.keyPrefix + key).NewReader(ctx)
+	if err != nil {
+		g.log.DebugContext(ctx, "GCS read", "key", key, "err", err)
+		return nil, fmtErrorf("failed to fetch %q from GCS: %w", key, err)
+	}
+	defer r.Close()
+	g.log.DebugContext(ctx, "GCS read", "key", key,
+		"size", r.Attrs.Size, "encoding", r.Attrs.ContentEncoding)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmtErrorf("failed to read %q from GCS: %w", key, err)
+	}
+	return data, nil
+}
+
+// Discard deletes key from GCS. It refuses to do so unless UnsafeDelete was
+// set on the GCSBackendConfig and, if DeleteKeyAllowlist is non-empty, key
+// matches one of its patterns.
+func (g *GCSBackend) Discard(ctx context.Context, key string) error {
+	allowed := deleteAllowed(g.unsafeDelete, g.deleteAllowlist, key)
+	g.deletes.WithLabelValues(fmt.Sprint(allowed)).Inc()
+	if !allowed {
+		return fmtErrorf("refusing to delete %q from GCS: UnsafeDelete is not set for this key", key)
+	}
+	err := g.client.Bucket(g.bucket).Object(g.keyPrefix + key).Delete(ctx)
+	g.log.DebugContext(ctx, "GCS delete", "key", key, "err", err)
+	if err != nil {
+		return fmtErrorf("failed to delete %q from GCS: %w", key, err)
+	}
+	return nil
+}
+
+// List yields every key with the given prefix, stopping early if the
+// consumer returns false.
+func (g *GCSBackend) List(ctx context.Context, prefix string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		it := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{Prefix: g.keyPrefix + prefix})
+		for {
+			attrs, err := it.Next()
+			if err == iterator.Done {
+				return
+			}
+			if err != nil {
+				yield("", fmtErrorf("failed to list %q from GCS: %w", prefix, err))
+				return
+			}
+			key := strings.TrimPrefix(attrs.Name, g.keyPrefix)
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (g *GCSBackend) Metrics() []prometheus.Collector {
+	return g.metrics
+}
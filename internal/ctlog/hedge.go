@@ -0,0 +1,216 @@
+package ctlog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// HedgingBackend wraps a Backend and, for both Upload and Fetch, launches a
+// second ("hedge") request against the same child if the first one is
+// slower than the adaptive delay computed from recent latencies. Whichever
+// request finishes first wins; the loser is canceled. This generalizes the
+// hedging that S3Backend used to do inline, so it can be applied to any
+// Backend implementation.
+//
+// Per the semantics of S3's If-None-Match on buckets with object lock,
+// Upload only hedges for non-immutable keys: two concurrent immutable
+// PutObjects with conflicting preconditions could otherwise race. Fetch
+// always hedges, since reads have no such conflict.
+type HedgingBackend struct {
+	backend  Backend
+	minDelay time.Duration
+	maxDelay time.Duration
+	log      *slog.Logger
+
+	metrics    []prometheus.Collector
+	latency    *prometheus.SummaryVec
+	hedgeDelay *prometheus.GaugeVec
+	hedges     *prometheus.CounterVec
+	hedgeWins  *prometheus.CounterVec
+}
+
+// HedgingBackendConfig configures a HedgingBackend. MinDelay and MaxDelay
+// default to 20ms and 500ms respectively.
+type HedgingBackendConfig struct {
+	MinDelay time.Duration
+	MaxDelay time.Duration
+}
+
+func NewHedgingBackend(cfg HedgingBackendConfig, backend Backend, l *slog.Logger) *HedgingBackend {
+	minDelay := cfg.MinDelay
+	if minDelay == 0 {
+		minDelay = 20 * time.Millisecond
+	}
+	maxDelay := cfg.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = 500 * time.Millisecond
+	}
+
+	latency := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "hedge_request_duration_seconds",
+			Help:       "Latency of the first attempt of a hedged operation, by operation.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.95: 0.005, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+		[]string{"op"},
+	)
+	hedgeDelay := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "hedge_delay_seconds",
+			Help: "Current adaptive hedge delay, by operation.",
+		},
+		[]string{"op"},
+	)
+	hedges := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedges_total",
+			Help: "Hedge requests launched because the first attempt was too slow, by operation.",
+		},
+		[]string{"op"},
+	)
+	hedgeWins := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedges_successful_total",
+			Help: "Hedge requests that completed before the first attempt, by operation.",
+		},
+		[]string{"op"},
+	)
+
+	return &HedgingBackend{
+		backend:    backend,
+		minDelay:   minDelay,
+		maxDelay:   maxDelay,
+		log:        l,
+		metrics:    []prometheus.Collector{latency, hedgeDelay, hedges, hedgeWins},
+		latency:    latency,
+		hedgeDelay: hedgeDelay,
+		hedges:     hedges,
+		hedgeWins:  hedgeWins,
+	}
+}
+
+var _ Backend = &HedgingBackend{}
+
+// delayFor returns the current adaptive hedge delay for op, derived from its
+// rolling p95 latency and clamped to [minDelay, maxDelay].
+func (h *HedgingBackend) delayFor(op string) time.Duration {
+	delay := h.minDelay
+	if p95, ok := summaryQuantile(h.latency.WithLabelValues(op), 0.95); ok {
+		delay = time.Duration(p95 * float64(time.Second))
+		if delay < h.minDelay {
+			delay = h.minDelay
+		}
+		if delay > h.maxDelay {
+			delay = h.maxDelay
+		}
+	}
+	h.hedgeDelay.WithLabelValues(op).Set(delay.Seconds())
+	return delay
+}
+
+// summaryQuantile reads back the named quantile from a Summary that a
+// SummaryVec.WithLabelValues call produced, by way of the metric's own
+// Write method. It returns false until enough observations have landed
+// for the quantile to be defined.
+func summaryQuantile(obs prometheus.Observer, quantile float64) (float64, bool) {
+	metric, ok := obs.(prometheus.Metric)
+	if !ok {
+		return 0, false
+	}
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		return 0, false
+	}
+	for _, q := range m.GetSummary().GetQuantile() {
+		if q.GetQuantile() == quantile {
+			if v := q.GetValue(); !math.IsNaN(v) {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (h *HedgingBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	if opts != nil && opts.Immutable {
+		// Never hedge immutable uploads: two concurrent PutObjects with
+		// conflicting If-None-Match preconditions can fail each other on
+		// buckets with object lock enabled.
+		start := time.Now()
+		err := h.backend.Upload(ctx, key, data, opts)
+		h.latency.WithLabelValues("upload").Observe(time.Since(start).Seconds())
+		return err
+	}
+	return h.race(ctx, "upload", func(ctx context.Context) error {
+		return h.backend.Upload(ctx, key, data, opts)
+	})
+}
+
+func (h *HedgingBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := h.race(ctx, "fetch", func(ctx context.Context) error {
+		d, err := h.backend.Fetch(ctx, key)
+		if err != nil {
+			return err
+		}
+		data = d
+		return nil
+	})
+	return data, err
+}
+
+// race runs attempt once, and again after delayFor(op) if the first attempt
+// hasn't returned yet, returning whichever result comes first.
+func (h *HedgingBackend) race(ctx context.Context, op string, attempt func(ctx context.Context) error) error {
+	start := time.Now()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errors.New("race returned"))
+
+	type result struct {
+		err error
+	}
+	primary := make(chan result, 1)
+	go func() {
+		err := attempt(ctx)
+		h.latency.WithLabelValues(op).Observe(time.Since(start).Seconds())
+		primary <- result{err: err}
+	}()
+
+	timer := time.NewTimer(h.delayFor(op))
+	defer timer.Stop()
+	select {
+	case r := <-primary:
+		return r.err
+	case <-timer.C:
+	}
+
+	h.hedges.WithLabelValues(op).Inc()
+	hedge := make(chan result, 1)
+	go func() {
+		err := attempt(ctx)
+		hedge <- result{err: err}
+	}()
+
+	select {
+	case r := <-primary:
+		cancel(errors.New("primary attempt won the race"))
+		return r.err
+	case r := <-hedge:
+		h.hedgeWins.WithLabelValues(op).Inc()
+		cancel(errors.New("hedge attempt won the race"))
+		return r.err
+	}
+}
+
+func (h *HedgingBackend) Metrics() []prometheus.Collector {
+	all := append([]prometheus.Collector{}, h.metrics...)
+	return append(all, h.backend.Metrics()...)
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"iter"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -15,6 +18,22 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// LocalBackendConfig is the configuration accepted by the "local" backend
+// driver registered with RegisterBackend.
+type LocalBackendConfig struct {
+	Directory string
+}
+
+func init() {
+	RegisterBackend("local", func(ctx context.Context, cfg any, l *slog.Logger) (Backend, error) {
+		c, ok := cfg.(LocalBackendConfig)
+		if !ok {
+			return nil, fmt.Errorf("local backend config must be a LocalBackendConfig, got %T", cfg)
+		}
+		return NewLocalBackend(ctx, c.Directory, l)
+	})
+}
+
 type LocalBackend struct {
 	dir      string
 	metrics  []prometheus.Collector
@@ -119,6 +138,40 @@ func (s *LocalBackend) Discard(ctx context.Context, key string) error {
 	return os.Remove(path)
 }
 
+// List yields every key under prefix, in lexical order, stopping early if
+// the consumer returns false. An error during the walk ends the listing and
+// is yielded once, as the last value; a prefix that does not exist yields
+// nothing.
+func (s *LocalBackend) List(ctx context.Context, prefix string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		name, err := filepath.Localize(prefix)
+		if err != nil {
+			yield("", fmtErrorf("failed to localize prefix %q as a filesystem path: %w", prefix, err))
+			return
+		}
+		root := filepath.Join(s.dir, name)
+		walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(s.dir, path)
+			if err != nil {
+				return err
+			}
+			if !yield(filepath.ToSlash(rel), nil) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if walkErr != nil && !errors.Is(walkErr, fs.SkipAll) && !os.IsNotExist(walkErr) {
+			yield("", fmtErrorf("failed to list %q: %w", prefix, walkErr))
+		}
+	}
+}
+
 func (s *LocalBackend) Metrics() []prometheus.Collector {
 	return s.metrics
 }
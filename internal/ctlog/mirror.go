@@ -0,0 +1,394 @@
+package ctlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MirrorBackend fans writes out to a set of child Backends and serves reads
+// from whichever child answers first, so an operator can combine a local hot
+// path with one or more S3 (or other) backends for cross-region or hybrid
+// durability without changing anything above the Backend interface.
+type MirrorBackend struct {
+	children []Backend
+	names    []string
+	quorum   int
+	log      *slog.Logger
+
+	metrics          []prometheus.Collector
+	uploadLag        *prometheus.SummaryVec
+	divergence       *prometheus.CounterVec
+	repairs          *prometheus.CounterVec
+	degradedRollback *prometheus.CounterVec
+
+	maxRetryQueue int
+	retryMu       sync.Mutex
+	retryQueue    []mirrorRetry
+
+	verifyRate float64
+}
+
+type mirrorRetry struct {
+	child int
+	key   string
+	data  []byte
+	opts  *UploadOptions
+}
+
+// MirrorBackendConfig configures a MirrorBackend. Names must have the same
+// length as Children and is used only to label metrics and log lines.
+type MirrorBackendConfig struct {
+	Children []Backend
+	Names    []string
+
+	// Quorum is the number of children that must acknowledge an Upload
+	// before it is considered successful. It defaults to len(Children), i.e.
+	// all children must succeed.
+	Quorum int
+
+	// MaxRetryQueue bounds the number of failed background writes kept for
+	// retry; once full, the oldest pending write is dropped.
+	MaxRetryQueue int
+
+	// ImmutableVerifyRate is the fraction, in [0, 1], of Immutable uploads
+	// that get an extra readback Fetch to confirm the child's stored bytes
+	// actually match what was written. It defaults to 0.01 (1% of uploads):
+	// checking every single one would double request volume and latency for
+	// the common case of immutable tile writes, so this is done on a
+	// sampled basis, the same tradeoff Fetch already makes when comparing
+	// hedge responses.
+	ImmutableVerifyRate float64
+}
+
+func NewMirrorBackend(cfg MirrorBackendConfig, l *slog.Logger) (*MirrorBackend, error) {
+	if len(cfg.Children) == 0 {
+		return nil, errors.New("mirror backend requires at least one child")
+	}
+	if len(cfg.Names) != len(cfg.Children) {
+		return nil, errors.New("mirror backend names must match children")
+	}
+	quorum := cfg.Quorum
+	if quorum == 0 {
+		quorum = len(cfg.Children)
+	}
+	if quorum < 1 || quorum > len(cfg.Children) {
+		return nil, fmt.Errorf("mirror backend quorum %d out of range for %d children", quorum, len(cfg.Children))
+	}
+	verifyRate := cfg.ImmutableVerifyRate
+	if verifyRate == 0 {
+		verifyRate = 0.01
+	}
+
+	uploadLag := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "mirror_upload_lag_seconds",
+			Help:       "Time for a child's upload to complete, measured from the start of the mirrored Upload.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			MaxAge:     1 * time.Minute,
+			AgeBuckets: 6,
+		},
+		[]string{"child"},
+	)
+	divergence := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mirror_divergence_total",
+			Help: "Times a child's content did not match the child serving a Fetch, or the data of a sampled Immutable upload readback.",
+		},
+		[]string{"child"},
+	)
+	repairs := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mirror_repairs_total",
+			Help: "Queued child writes that succeeded on Retry after initially failing.",
+		},
+		[]string{"child"},
+	)
+	degradedRollback := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mirror_discard_degraded_rollback_total",
+			Help: "Discard rollbacks that restored a child's data without its original UploadOptions.",
+		},
+		[]string{"child"},
+	)
+
+	m := &MirrorBackend{
+		children:         cfg.Children,
+		names:            cfg.Names,
+		quorum:           quorum,
+		maxRetryQueue:    cfg.MaxRetryQueue,
+		verifyRate:       verifyRate,
+		log:              l,
+		metrics:          []prometheus.Collector{uploadLag, divergence, repairs, degradedRollback},
+		uploadLag:        uploadLag,
+		divergence:       divergence,
+		repairs:          repairs,
+		degradedRollback: degradedRollback,
+	}
+	return m, nil
+}
+
+var _ Backend = &MirrorBackend{}
+
+func (m *MirrorBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	start := time.Now()
+	results := make(chan error, len(m.children))
+	for i, child := range m.children {
+		i, child := i, child
+		go func() {
+			err := child.Upload(ctx, key, data, opts)
+			if err == nil && opts != nil && opts.Immutable && rand.Float64() < m.verifyRate {
+				// The upload may have been idempotent against a pre-existing
+				// object (as LocalBackend's Immutable handling is); confirm
+				// it's still byte-identical to what we just wrote, the same
+				// guarantee compareFile gives LocalBackend. Only a sample of
+				// uploads pay for the extra readback Fetch (see
+				// ImmutableVerifyRate), but one that's checked and found
+				// diverging is treated as an upload failure: it must count
+				// against quorum and get queued for retry like any other
+				// failure, not be silently logged while still reporting
+				// success.
+				if verr := verifyImmutableReadback(ctx, child, key, data); verr != nil {
+					m.divergence.WithLabelValues(m.names[i]).Inc()
+					err = fmt.Errorf("immutable readback check failed: %w", verr)
+					m.log.Error("mirror immutable upload failed readback check",
+						"child", m.names[i], "key", key, "err", err)
+				}
+			}
+			m.uploadLag.WithLabelValues(m.names[i]).Observe(time.Since(start).Seconds())
+			results <- err
+			if err != nil {
+				m.queueRetry(i, key, data, opts)
+			}
+		}()
+	}
+
+	var succeeded, failed int
+	var firstErr error
+	for range m.children {
+		if err := <-results; err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			succeeded++
+		}
+		if succeeded >= m.quorum {
+			// Quorum met: return success and let the remaining children
+			// finish in the background via the still-running goroutines
+			// above; any that fail are queued for a later Retry call.
+			return nil
+		}
+		if failed > len(m.children)-m.quorum {
+			break
+		}
+	}
+	return fmtErrorf("failed to reach mirror quorum of %d for %q: %w", m.quorum, key, firstErr)
+}
+
+// verifyImmutableReadback fetches key back from child and confirms it
+// matches data byte-for-byte.
+func verifyImmutableReadback(ctx context.Context, child Backend, key string, data []byte) error {
+	got, err := child.Fetch(ctx, key)
+	if err != nil {
+		return fmt.Errorf("readback fetch failed: %w", err)
+	}
+	if !bytes.Equal(got, data) {
+		return errors.New("readback data does not match upload")
+	}
+	return nil
+}
+
+func (m *MirrorBackend) queueRetry(child int, key string, data []byte, opts *UploadOptions) {
+	m.retryMu.Lock()
+	defer m.retryMu.Unlock()
+	if m.maxRetryQueue > 0 && len(m.retryQueue) >= m.maxRetryQueue {
+		dropped := m.retryQueue[0]
+		m.retryQueue = m.retryQueue[1:]
+		m.log.Error("mirror retry queue full, dropping oldest pending write",
+			"child", m.names[dropped.child], "key", dropped.key)
+	}
+	m.retryQueue = append(m.retryQueue, mirrorRetry{child: child, key: key, data: data, opts: opts})
+	m.log.Warn("mirror child upload failed, queued for retry", "child", m.names[child], "key", key)
+}
+
+// Retry attempts to flush the bounded background retry queue, and should be
+// called periodically (e.g. on a timer) by the caller. It is not run
+// automatically by Upload.
+func (m *MirrorBackend) Retry(ctx context.Context) {
+	m.retryMu.Lock()
+	pending := m.retryQueue
+	m.retryQueue = nil
+	m.retryMu.Unlock()
+
+	var remaining []mirrorRetry
+	for _, r := range pending {
+		if err := m.children[r.child].Upload(ctx, r.key, r.data, r.opts); err != nil {
+			remaining = append(remaining, r)
+			continue
+		}
+		m.repairs.WithLabelValues(m.names[r.child]).Inc()
+		m.log.Info("mirror repair succeeded", "child", m.names[r.child], "key", r.key)
+	}
+
+	m.retryMu.Lock()
+	m.retryQueue = append(remaining, m.retryQueue...)
+	m.retryMu.Unlock()
+}
+
+func (m *MirrorBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errors.New("fetch returned"))
+
+	type result struct {
+		child int
+		data  []byte
+		err   error
+	}
+	results := make(chan result, len(m.children))
+	for i, child := range m.children {
+		i, child := i, child
+		delay := time.Duration(i) * 75 * time.Millisecond
+		go func() {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				// Still send a result: the collector loop below always reads
+				// exactly len(m.children) times, and a child that never sends
+				// would hang it forever once a winner cancels the others.
+				results <- result{child: i, err: context.Cause(ctx)}
+				return
+			case <-timer.C:
+			}
+			data, err := child.Fetch(ctx, key)
+			results <- result{child: i, data: data, err: err}
+		}()
+	}
+
+	var firstErr error
+	var winner *result
+	for range m.children {
+		r := <-results
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		if winner == nil {
+			w := r
+			winner = &w
+			cancel(errors.New("preferred child answered"))
+			continue
+		}
+		if !bytes.Equal(winner.data, r.data) {
+			m.divergence.WithLabelValues(m.names[r.child]).Inc()
+			m.log.Error("mirror children disagree on content", "key", key,
+				"winner", m.names[winner.child], "child", m.names[r.child])
+		}
+	}
+	if winner == nil {
+		return nil, fmtErrorf("failed to fetch %q from any mirror child: %w", key, firstErr)
+	}
+	return winner.data, nil
+}
+
+type mirrorDiscarder interface {
+	Discard(ctx context.Context, key string) error
+}
+
+type mirrorDiscardChild struct {
+	name      string
+	discarder mirrorDiscarder
+	child     Backend
+	data      []byte
+}
+
+// Discard removes key from every child using a two-phase, compensating-
+// rollback dance, since the Backend interface has no native two-phase
+// commit: it first reads back each child's current data (prepare), then
+// discards from every child in turn (commit). If a commit fails partway
+// through, the children that already discarded successfully have their
+// data re-uploaded to undo the partial delete and Discard returns an error.
+// The key then exists again on every child, except that a restored copy is
+// written without its original UploadOptions, and a child whose re-upload
+// fails is left without the key (see rollbackDiscard).
+func (m *MirrorBackend) Discard(ctx context.Context, key string) error {
+	prepared := make([]mirrorDiscardChild, len(m.children))
+	for i, child := range m.children {
+		d, ok := child.(mirrorDiscarder)
+		if !ok {
+			return fmtErrorf("mirror child %s does not support Discard", m.names[i])
+		}
+		data, err := child.Fetch(ctx, key)
+		if err != nil {
+			return fmtErrorf("failed to read %q from mirror child %s before discard: %w", key, m.names[i], err)
+		}
+		prepared[i] = mirrorDiscardChild{name: m.names[i], discarder: d, child: child, data: data}
+	}
+
+	for i, p := range prepared {
+		if err := p.discarder.Discard(ctx, key); err != nil {
+			m.rollbackDiscard(ctx, key, prepared[:i])
+			return fmtErrorf("failed to discard %q from mirror child %s: %w", key, p.name, err)
+		}
+	}
+	return nil
+}
+
+// rollbackDiscard re-uploads key to every child in done, compensating for a
+// Discard that succeeded on them but failed on a later child. Backend.Fetch
+// does not return the original UploadOptions, so the re-upload goes through
+// as a plain mutable write: a rolled-back child permanently loses whatever
+// Immutable/ContentType/Compressed flags it originally had, which on
+// S3Backend means falling out of the immutable storage class and losing the
+// "immutable" Cache-Control header, and on LocalBackend means losing the
+// 0444 permissions and OS-immutable flag. That child now silently diverges
+// from its siblings, so this is logged loudly and counted rather than
+// treated as a clean recovery.
+func (m *MirrorBackend) rollbackDiscard(ctx context.Context, key string, done []mirrorDiscardChild) {
+	for _, p := range done {
+		if err := p.child.Upload(ctx, key, p.data, nil); err != nil {
+			m.log.Error("mirror discard rollback failed, child left without restored data",
+				"child", p.name, "key", key, "err", err)
+			continue
+		}
+		m.degradedRollback.WithLabelValues(p.name).Inc()
+		m.log.Error("mirror discard rolled back after partial failure: restored data lost its "+
+			"original UploadOptions and may now diverge in storage class, cache headers, or file "+
+			"permissions from its siblings", "child", p.name, "key", key)
+	}
+}
+
+// List lists from the first (preferred) child that supports it.
+func (m *MirrorBackend) List(ctx context.Context, prefix string) iter.Seq2[string, error] {
+	type lister interface {
+		List(ctx context.Context, prefix string) iter.Seq2[string, error]
+	}
+	for _, child := range m.children {
+		if l, ok := child.(lister); ok {
+			return l.List(ctx, prefix)
+		}
+	}
+	return func(yield func(string, error) bool) {
+		yield("", errors.New("ctlog: no mirror child supports List"))
+	}
+}
+
+func (m *MirrorBackend) Metrics() []prometheus.Collector {
+	all := append([]prometheus.Collector{}, m.metrics...)
+	for _, child := range m.children {
+		all = append(all, child.Metrics()...)
+	}
+	return all
+}
@@ -0,0 +1,207 @@
+package ctlog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeBackend is a minimal in-memory Backend for exercising MirrorBackend's
+// quorum, rollback, and hedge-cancellation logic without real network I/O.
+type fakeBackend struct {
+	mu   sync.Mutex
+	data map[string][]byte
+
+	uploadErr  error
+	discardErr error
+
+	// fetchDelay, if non-zero, makes Fetch wait before returning, to
+	// exercise Fetch's hedge-cancellation against a slow child.
+	fetchDelay time.Duration
+
+	// done, if non-nil, is signaled once Upload returns. MirrorBackend's
+	// goroutine for this child still does its own bookkeeping (such as
+	// queueing a retry) after that, so tests wait on done and then poll for
+	// that state.
+	done *sync.WaitGroup
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{data: make(map[string][]byte)}
+}
+
+func (f *fakeBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	if f.done != nil {
+		defer f.done.Done()
+	}
+	if f.uploadErr != nil {
+		return f.uploadErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (f *fakeBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	if f.fetchDelay > 0 {
+		select {
+		case <-time.After(f.fetchDelay):
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.data[key]
+	if !ok {
+		return nil, errors.New("fakeBackend: key not found")
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (f *fakeBackend) Discard(ctx context.Context, key string) error {
+	if f.discardErr != nil {
+		return f.discardErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.data, key)
+	return nil
+}
+
+func (f *fakeBackend) Metrics() []prometheus.Collector { return nil }
+
+var _ Backend = &fakeBackend{}
+var _ mirrorDiscarder = &fakeBackend{}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestMirrorUploadQuorumAndRetry(t *testing.T) {
+	good1, good2 := newFakeBackend(), newFakeBackend()
+	bad := newFakeBackend()
+	bad.uploadErr = errors.New("child unavailable")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	bad.done = &wg
+
+	m, err := NewMirrorBackend(MirrorBackendConfig{
+		Children: []Backend{good1, good2, bad},
+		Names:    []string{"good1", "good2", "bad"},
+		Quorum:   2,
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("NewMirrorBackend: %v", err)
+	}
+
+	if err := m.Upload(context.Background(), "key", []byte("data"), nil); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	wg.Wait()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.retryMu.Lock()
+		n := len(m.retryQueue)
+		m.retryMu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	m.retryMu.Lock()
+	defer m.retryMu.Unlock()
+	if len(m.retryQueue) != 1 {
+		t.Fatalf("retryQueue has %d entries, want 1", len(m.retryQueue))
+	}
+	if got := m.retryQueue[0].child; got != 2 {
+		t.Errorf("retryQueue[0].child = %d, want 2 (bad)", got)
+	}
+}
+
+func TestMirrorDiscardRollback(t *testing.T) {
+	good1, good2 := newFakeBackend(), newFakeBackend()
+	bad := newFakeBackend()
+	bad.discardErr = errors.New("discard refused")
+
+	const key = "tile/3/x001.p/008"
+	const original = "original data"
+	for _, c := range []*fakeBackend{good1, good2, bad} {
+		c.data[key] = []byte(original)
+	}
+
+	m, err := NewMirrorBackend(MirrorBackendConfig{
+		Children: []Backend{good1, good2, bad},
+		Names:    []string{"good1", "good2", "bad"},
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("NewMirrorBackend: %v", err)
+	}
+
+	if err := m.Discard(context.Background(), key); err == nil {
+		t.Fatal("Discard succeeded, want error from bad child")
+	}
+
+	for name, c := range map[string]*fakeBackend{"good1": good1, "good2": good2} {
+		got, err := c.Fetch(context.Background(), key)
+		if err != nil {
+			t.Errorf("%s: Fetch after rollback: %v", name, err)
+			continue
+		}
+		if string(got) != original {
+			t.Errorf("%s: data after rollback = %q, want %q", name, got, original)
+		}
+	}
+
+	if got, ok := bad.data[key]; !ok || string(got) != original {
+		t.Errorf("bad child data = %q (present: %v), want %q: its Discard failed, so it must keep the key", got, ok, original)
+	}
+}
+
+func TestMirrorFetchHedgeCancellation(t *testing.T) {
+	fast := newFakeBackend()
+	fast.data["key"] = []byte("fast data")
+	slow := newFakeBackend()
+	slow.data["key"] = []byte("fast data")
+	slow.fetchDelay = time.Hour
+
+	m, err := NewMirrorBackend(MirrorBackendConfig{
+		Children: []Backend{fast, slow},
+		Names:    []string{"fast", "slow"},
+	}, discardLogger())
+	if err != nil {
+		t.Fatalf("NewMirrorBackend: %v", err)
+	}
+
+	type fetchResult struct {
+		data []byte
+		err  error
+	}
+	done := make(chan fetchResult, 1)
+	go func() {
+		data, err := m.Fetch(context.Background(), "key")
+		done <- fetchResult{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("Fetch: %v", r.err)
+		}
+		if string(r.data) != "fast data" {
+			t.Errorf("Fetch = %q, want %q", r.data, "fast data")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Fetch did not return within 2s; a slow hedge child may be hanging the collector loop")
+	}
+}
@@ -0,0 +1,56 @@
+package ctlog
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrReadOnly is returned by ReadOnlyBackend's Upload and Discard.
+var ErrReadOnly = errors.New("ctlog: backend is read-only")
+
+// ReadOnlyBackend wraps a Backend and refuses all writes, so an old
+// archival bucket or similar can be attached to a MirrorBackend or a
+// witness configuration as a read-only source without risking an
+// accidental write or deletion.
+type ReadOnlyBackend struct {
+	backend Backend
+}
+
+func NewReadOnlyBackend(b Backend) *ReadOnlyBackend {
+	return &ReadOnlyBackend{backend: b}
+}
+
+var _ Backend = &ReadOnlyBackend{}
+
+func (r *ReadOnlyBackend) Upload(ctx context.Context, key string, data []byte, opts *UploadOptions) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyBackend) Discard(ctx context.Context, key string) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyBackend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	return r.backend.Fetch(ctx, key)
+}
+
+// List passes through to the wrapped backend if it supports listing, and
+// otherwise yields a single error.
+func (r *ReadOnlyBackend) List(ctx context.Context, prefix string) iter.Seq2[string, error] {
+	lister, ok := r.backend.(interface {
+		List(ctx context.Context, prefix string) iter.Seq2[string, error]
+	})
+	if !ok {
+		return func(yield func(string, error) bool) {
+			yield("", errors.New("ctlog: wrapped backend does not support List"))
+		}
+	}
+	return lister.List(ctx, prefix)
+}
+
+func (r *ReadOnlyBackend) Metrics() []prometheus.Collector {
+	return r.backend.Metrics()
+}
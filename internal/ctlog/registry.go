@@ -0,0 +1,48 @@
+package ctlog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// BackendFactory constructs a Backend from a driver-specific configuration
+// value, typically decoded from the `backend:` section of sunlight.yaml.
+type BackendFactory func(ctx context.Context, cfg any, logger *slog.Logger) (Backend, error)
+
+var backendRegistry struct {
+	mu      sync.Mutex
+	drivers map[string]BackendFactory
+}
+
+// RegisterBackend makes a backend driver available under name for use in the
+// `backend: { type: <name>, ... }` section of sunlight.yaml. It is meant to
+// be called from an init function, both by this package's built-in drivers
+// ("local", "s3", "gcs", "azblob") and by third-party drivers (e.g. "tigris")
+// imported for side effect by a custom build of sunlight. RegisterBackend
+// panics if name is already registered.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendRegistry.mu.Lock()
+	defer backendRegistry.mu.Unlock()
+	if backendRegistry.drivers == nil {
+		backendRegistry.drivers = make(map[string]BackendFactory)
+	}
+	if _, ok := backendRegistry.drivers[name]; ok {
+		panic("ctlog: backend driver " + name + " registered twice")
+	}
+	backendRegistry.drivers[name] = factory
+}
+
+// NewBackend looks up the driver registered as name and uses it to construct
+// a Backend from cfg, which the driver is expected to type-assert to its own
+// configuration type.
+func NewBackend(ctx context.Context, name string, cfg any, logger *slog.Logger) (Backend, error) {
+	backendRegistry.mu.Lock()
+	factory, ok := backendRegistry.drivers[name]
+	backendRegistry.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend driver %q", name)
+	}
+	return factory(ctx, cfg, logger)
+}
@@ -3,34 +3,116 @@ package ctlog
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go/logging"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// S3BackendConfig holds the parameters for NewS3Backend. Region and Bucket
+// are required; the rest have sensible zero values.
+type S3BackendConfig struct {
+	Region    string
+	Bucket    string
+	Endpoint  string
+	KeyPrefix string
+
+	// ImmutableStorageClass is used for uploads with UploadOptions.Immutable
+	// set, unless overridden per-call by UploadOptions.StorageClass. It
+	// defaults to types.StorageClassStandardIa, which suits tile data that is
+	// written once and read rarely outside of audits.
+	ImmutableStorageClass types.StorageClass
+
+	// MutableStorageClass is used for uploads without UploadOptions.Immutable
+	// set, such as the checkpoint and the rightmost partial tiles. It
+	// defaults to types.StorageClassStandard.
+	MutableStorageClass types.StorageClass
+
+	// DisableStorageClass prevents the StorageClass field from being set on
+	// PutObjectInput at all, for S3-compatible backends (MinIO, R2, Tigris)
+	// that reject unrecognized storage classes.
+	DisableStorageClass bool
+
+	// SSEAlgorithm selects server-side encryption, e.g. types.ServerSideEncryptionAes256
+	// or types.ServerSideEncryptionAwsKms. It is mutually exclusive with
+	// SSECustomerKey.
+	SSEAlgorithm types.ServerSideEncryption
+
+	// SSEKMSKeyID is the KMS key ID or ARN to use when SSEAlgorithm is
+	// types.ServerSideEncryptionAwsKms. Leave empty to use the bucket's
+	// default KMS key.
+	SSEKMSKeyID string
+
+	// SSECustomerKey enables SSE-C with this 256-bit key. It is mutually
+	// exclusive with SSEAlgorithm, and is never logged.
+	SSECustomerKey []byte
+
+	// UnsafeDelete must be set for Discard to issue DeleteObject at all; by
+	// default Discard always refuses.
+	UnsafeDelete bool
+
+	// DeleteKeyAllowlist, if non-empty, restricts Discard to keys matching
+	// one of these globMatch patterns (e.g. "tile/**/*.p/*" for partial tiles
+	// only, where "**" matches any number of path segments), even when
+	// UnsafeDelete is set.
+	DeleteKeyAllowlist []string
+}
+
 type S3Backend struct {
-	client        *s3.Client
-	bucket        string
-	keyPrefix     string
-	metrics       []prometheus.Collector
-	uploadSize    prometheus.Summary
-	hedgeRequests prometheus.Counter
-	hedgeWins     prometheus.Counter
-	log           *slog.Logger
+	client           *s3.Client
+	bucket           string
+	keyPrefix        string
+	immutableClass   types.StorageClass
+	mutableClass     types.StorageClass
+	disableClass     bool
+	sseAlgorithm     types.ServerSideEncryption
+	sseKMSKeyID      string
+	sseCustomerKey   []byte
+	unsafeDelete     bool
+	deleteAllowlist  []string
+	metrics          []prometheus.Collector
+	uploadSize       *prometheus.SummaryVec
+	checksumMismatch *prometheus.CounterVec
+	deletes          *prometheus.CounterVec
+	log              *slog.Logger
+}
+
+func init() {
+	RegisterBackend("s3", func(ctx context.Context, cfg any, l *slog.Logger) (Backend, error) {
+		c, ok := cfg.(S3BackendConfig)
+		if !ok {
+			return nil, fmt.Errorf("s3 backend config must be a S3BackendConfig, got %T", cfg)
+		}
+		return NewS3Backend(ctx, c, l)
+	})
 }
 
-func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix string, l *slog.Logger) (*S3Backend, error) {
+func NewS3Backend(ctx context.Context, cfg S3BackendConfig, l *slog.Logger) (*S3Backend, error) {
+	region, bucket, endpoint, keyPrefix := cfg.Region, cfg.Bucket, cfg.Endpoint, cfg.KeyPrefix
+	immutableClass := cfg.ImmutableStorageClass
+	if immutableClass == "" {
+		immutableClass = types.StorageClassStandardIa
+	}
+	mutableClass := cfg.MutableStorageClass
+	if mutableClass == "" {
+		mutableClass = types.StorageClassStandard
+	}
 	duration := prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name:       "s3_request_duration_seconds",
@@ -48,7 +130,7 @@ func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix strin
 		},
 		[]string{"retryable", "errorcode"},
 	)
-	uploadSize := prometheus.NewSummary(
+	uploadSize := prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name:       "s3_upload_size_bytes",
 			Help:       "S3 body size in bytes for object puts.",
@@ -56,30 +138,33 @@ func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix strin
 			MaxAge:     1 * time.Minute,
 			AgeBuckets: 6,
 		},
+		[]string{"storage_class"},
 	)
-	hedgeRequests := prometheus.NewCounter(
+	checksumMismatch := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "s3_hedges_total",
-			Help: "S3 hedge requests that were launched because the main request was too slow.",
+			Name: "s3_checksum_mismatch_total",
+			Help: "S3 requests where the end-to-end SHA-256 checksum did not match.",
 		},
+		[]string{"operation"},
 	)
-	hedgeWins := prometheus.NewCounter(
+	deletes := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "s3_hedges_successful_total",
-			Help: "S3 hedge requests that completed before the main request.",
+			Name: "s3_deletes_total",
+			Help: "S3 Discard calls, by whether the delete was allowed to proceed.",
 		},
+		[]string{"allowed"},
 	)
 
 	transport := http.RoundTripper(http.DefaultTransport.(*http.Transport).Clone())
 	transport = promhttp.InstrumentRoundTripperDuration(duration, transport)
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	awsConfig, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config for S3 backend: %w", err)
 	}
 
 	return &S3Backend{
-		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+		client: s3.NewFromConfig(awsConfig, func(o *s3.Options) {
 			o.Region = region
 			if endpoint != "" {
 				o.BaseEndpoint = aws.String(endpoint)
@@ -93,16 +178,44 @@ func NewS3Backend(ctx context.Context, region, bucket, endpoint, keyPrefix strin
 			o.Logger = awsLogger{log: l}
 			o.ClientLogMode = aws.LogRequest | aws.LogResponse | aws.LogRetries
 		}),
-		bucket:        bucket,
-		keyPrefix:     keyPrefix,
-		metrics:       []prometheus.Collector{duration, uploadSize, hedgeRequests, hedgeWins},
-		uploadSize:    uploadSize,
-		hedgeRequests: hedgeRequests,
-		hedgeWins:     hedgeWins,
-		log:           l,
+		bucket:           bucket,
+		keyPrefix:        keyPrefix,
+		immutableClass:   immutableClass,
+		mutableClass:     mutableClass,
+		disableClass:     cfg.DisableStorageClass,
+		sseAlgorithm:     cfg.SSEAlgorithm,
+		sseKMSKeyID:      cfg.SSEKMSKeyID,
+		sseCustomerKey:   cfg.SSECustomerKey,
+		unsafeDelete:     cfg.UnsafeDelete,
+		deleteAllowlist:  cfg.DeleteKeyAllowlist,
+		metrics:          []prometheus.Collector{duration, uploadSize, checksumMismatch, deletes},
+		uploadSize:       uploadSize,
+		checksumMismatch: checksumMismatch,
+		deletes:          deletes,
+		log:              l,
 	}, nil
 }
 
+// sseParams returns the server-side encryption fields to set on
+// PutObjectInput and GetObjectInput. SSECustomerKey material is never
+// included in logs.
+func (s *S3Backend) sseParams() (algorithm types.ServerSideEncryption, kmsKeyID *string, customerAlgorithm, customerKey, customerKeyMD5 *string) {
+	if len(s.sseCustomerKey) > 0 {
+		sum := md5.Sum(s.sseCustomerKey)
+		customerAlgorithm = aws.String("AES256")
+		customerKey = aws.String(base64.StdEncoding.EncodeToString(s.sseCustomerKey))
+		customerKeyMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+		return "", nil, customerAlgorithm, customerKey, customerKeyMD5
+	}
+	if s.sseAlgorithm != "" {
+		algorithm = s.sseAlgorithm
+		if s.sseKMSKeyID != "" {
+			kmsKeyID = aws.String(s.sseKMSKeyID)
+		}
+	}
+	return algorithm, kmsKeyID, nil, nil, nil
+}
+
 type trackingRetryerV2 struct {
 	aws.RetryerV2
 	errors *prometheus.CounterVec
@@ -146,54 +259,66 @@ func (s *S3Backend) Upload(ctx context.Context, key string, data []byte, opts *U
 	if opts != nil && opts.Immutable {
 		cacheControl = aws.String("public, max-age=604800, immutable")
 	}
-	putObject := func() (*s3.PutObjectOutput, error) {
-		return s.client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket:          aws.String(s.bucket),
-			Key:             aws.String(s.keyPrefix + key),
-			Body:            bytes.NewReader(data),
-			ContentLength:   aws.Int64(int64(len(data))),
-			ContentEncoding: contentEncoding,
-			ContentType:     contentType,
-			CacheControl:    cacheControl,
-		})
-	}
-	ctx, cancel := context.WithCancelCause(ctx)
-	hedgeErr := make(chan error, 1)
-	go func() {
-		timer := time.NewTimer(75 * time.Millisecond)
-		defer timer.Stop()
-		select {
-		case <-ctx.Done():
-		case <-timer.C:
-			s.hedgeRequests.Inc()
-			_, err := putObject()
-			s.log.DebugContext(ctx, "S3 PUT hedge", "key", key, "err", err)
-			hedgeErr <- err
-			cancel(errors.New("competing request succeeded"))
-		}
-	}()
-	_, err := putObject()
-	select {
-	case err = <-hedgeErr:
-		s.hedgeWins.Inc()
-	default:
-		cancel(errors.New("competing request succeeded"))
+	storageClass := s.storageClassFor(opts)
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	sseAlgorithm, sseKMSKeyID, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 := s.sseParams()
+	out, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.keyPrefix + key),
+		Body:                 bytes.NewReader(data),
+		ContentLength:        aws.Int64(int64(len(data))),
+		ContentEncoding:      contentEncoding,
+		ContentType:          contentType,
+		CacheControl:         cacheControl,
+		StorageClass:         storageClass,
+		ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:       aws.String(checksum),
+		ServerSideEncryption: sseAlgorithm,
+		SSEKMSKeyId:          sseKMSKeyID,
+		SSECustomerAlgorithm: sseCustomerAlgorithm,
+		SSECustomerKey:       sseCustomerKey,
+		SSECustomerKeyMD5:    sseCustomerKeyMD5,
+	})
+	if err == nil && out.ChecksumSHA256 != nil && *out.ChecksumSHA256 != checksum {
+		s.checksumMismatch.WithLabelValues("upload").Inc()
+		err = fmt.Errorf("S3 returned checksum %q, expected %q", *out.ChecksumSHA256, checksum)
 	}
 	s.log.DebugContext(ctx, "S3 PUT", "key", key, "size", len(data),
 		"compressed", contentEncoding != nil, "type", *contentType,
-		"immutable", cacheControl != nil,
+		"immutable", cacheControl != nil, "storageClass", storageClass,
 		"elapsed", time.Since(start), "err", err)
-	s.uploadSize.Observe(float64(len(data)))
+	s.uploadSize.WithLabelValues(string(storageClass)).Observe(float64(len(data)))
 	if err != nil {
 		return fmtErrorf("failed to upload %q to S3: %w", key, err)
 	}
 	return nil
 }
 
+// storageClassFor returns the StorageClass to set on PutObjectInput for the
+// given options, or the empty string if storage classes are disabled.
+func (s *S3Backend) storageClassFor(opts *UploadOptions) types.StorageClass {
+	if s.disableClass {
+		return ""
+	}
+	if opts != nil && opts.StorageClass != "" {
+		return opts.StorageClass
+	}
+	if opts != nil && opts.Immutable {
+		return s.immutableClass
+	}
+	return s.mutableClass
+}
+
 func (s *S3Backend) Fetch(ctx context.Context, key string) ([]byte, error) {
+	_, _, sseCustomerAlgorithm, sseCustomerKey, sseCustomerKeyMD5 := s.sseParams()
 	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.keyPrefix + key),
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.keyPrefix + key),
+		ChecksumMode:         types.ChecksumModeEnabled,
+		SSECustomerAlgorithm: sseCustomerAlgorithm,
+		SSECustomerKey:       sseCustomerKey,
+		SSECustomerKeyMD5:    sseCustomerKeyMD5,
 	})
 	if err != nil {
 		s.log.DebugContext(ctx, "S3 GET", "key", key, "err", err)
@@ -206,9 +331,65 @@ func (s *S3Backend) Fetch(ctx context.Context, key string) ([]byte, error) {
 	if err != nil {
 		return nil, fmtErrorf("failed to read %q from S3: %w", key, err)
 	}
+	if out.ChecksumSHA256 != nil {
+		sum := sha256.Sum256(data)
+		if got := base64.StdEncoding.EncodeToString(sum[:]); got != *out.ChecksumSHA256 {
+			s.checksumMismatch.WithLabelValues("fetch").Inc()
+			return nil, fmtErrorf("checksum mismatch fetching %q from S3: got %q, expected %q",
+				key, got, *out.ChecksumSHA256)
+		}
+	}
 	return data, nil
 }
 
+// Discard deletes key from S3. It refuses to do so unless UnsafeDelete was
+// set on the S3BackendConfig and, if DeleteKeyAllowlist is non-empty, key
+// matches one of its patterns.
+func (s *S3Backend) Discard(ctx context.Context, key string) error {
+	allowed := s.discardAllowed(key)
+	s.deletes.WithLabelValues(fmt.Sprint(allowed)).Inc()
+	if !allowed {
+		return fmtErrorf("refusing to delete %q from S3: UnsafeDelete is not set for this key", key)
+	}
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.keyPrefix + key),
+	})
+	s.log.DebugContext(ctx, "S3 DELETE", "key", key, "err", err)
+	if err != nil {
+		return fmtErrorf("failed to delete %q from S3: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Backend) discardAllowed(key string) bool {
+	return deleteAllowed(s.unsafeDelete, s.deleteAllowlist, key)
+}
+
+// List yields every key with the given prefix, in the order S3 returns
+// them (lexical by key), stopping early if the consumer returns false.
+func (s *S3Backend) List(ctx context.Context, prefix string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s.bucket),
+			Prefix: aws.String(s.keyPrefix + prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				yield("", fmtErrorf("failed to list %q from S3: %w", prefix, err))
+				return
+			}
+			for _, obj := range page.Contents {
+				key := strings.TrimPrefix(aws.ToString(obj.Key), s.keyPrefix)
+				if !yield(key, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
 func (s *S3Backend) Metrics() []prometheus.Collector {
 	return s.metrics
 }
@@ -0,0 +1,37 @@
+package ctlog
+
+import "testing"
+
+func TestDiscardAllowedPartialTiles(t *testing.T) {
+	s := &S3Backend{
+		unsafeDelete:    true,
+		deleteAllowlist: []string{"tile/**/*.p/*"},
+	}
+
+	allowed := []string{
+		"tile/3/x001.p/008",
+		"tile/x001.p/008",
+		"tile/3/x001/x002.p/128",
+	}
+	for _, key := range allowed {
+		if !s.discardAllowed(key) {
+			t.Errorf("discardAllowed(%q) = false, want true", key)
+		}
+	}
+
+	disallowed := []string{
+		"tile/3/x001",
+		"tile/x001",
+		"log.v3.json",
+		"checkpoint",
+	}
+	for _, key := range disallowed {
+		if s.discardAllowed(key) {
+			t.Errorf("discardAllowed(%q) = true, want false", key)
+		}
+	}
+
+	if (&S3Backend{unsafeDelete: false}).discardAllowed("tile/3/x001.p/008") {
+		t.Error("discardAllowed should refuse everything when unsafeDelete is false")
+	}
+}